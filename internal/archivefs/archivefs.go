@@ -0,0 +1,211 @@
+// Package archivefs exposes the archive formats srv can browse in-place
+// (zip, tar, tar.gz, 7z, iso) as fs.FS, so the handler and listing renderers
+// don't need format-specific branches.
+package archivefs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing/fstest"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/kdomanski/iso9660"
+)
+
+// opener opens the archive at p and returns it as an fs.FS, along with
+// an io.Closer that must be called once the caller is done with it.
+type opener func(p string) (fs.FS, io.Closer, error)
+
+// registry maps a recognized archive extension to the opener that can
+// turn a file with that extension into an fs.FS.
+var registry = map[string]opener{
+	".zip":    openZip,
+	".tar":    openTar,
+	".tar.gz": openTarGz,
+	".tgz":    openTarGz,
+	".7z":     open7z,
+	".iso":    openISO,
+}
+
+// knownExts is registry's keys, in the order Ext tries them. The compound
+// ".tar.gz" comes first; no key is a suffix of another, so the order of the
+// rest doesn't affect which one matches.
+var knownExts = []string{".tar.gz", ".tar", ".tgz", ".7z", ".iso", ".zip"}
+
+// maxDecompressedBytes bounds how much of a tar or iso archive tarToMapFS
+// and walkISO will hold in memory at once. Unlike zip (and 7z), which seek
+// to individual entries on demand, these formats only expose a forward-only
+// reader, so browsing one means decompressing it into an in-memory fs.FS up
+// front; without a cap, an oversized archive dropped into the served tree
+// is an easy way to exhaust the server's memory.
+const maxDecompressedBytes = 512 << 20
+
+// Ext returns the archive extension of name if srv knows how to browse it,
+// or "" otherwise.
+func Ext(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range knownExts {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Open opens the archive at p and returns it as an fs.FS, along with an
+// io.Closer that must be called once the caller is done with it.
+func Open(p string) (fs.FS, io.Closer, error) {
+	ext := Ext(p)
+	open, ok := registry[ext]
+	if !ok {
+		return nil, nil, fmt.Errorf("archivefs: unsupported archive extension %q", ext)
+	}
+	return open(p)
+}
+
+func openZip(p string) (fs.FS, io.Closer, error) {
+	z, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return z, z, nil
+}
+
+func open7z(p string) (fs.FS, io.Closer, error) {
+	r, err := sevenzip.OpenReader(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, r, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func openTar(p string) (fs.FS, io.Closer, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	m, err := tarToMapFS(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, nopCloser{}, nil
+}
+
+func openTarGz(p string) (fs.FS, io.Closer, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+	m, err := tarToMapFS(gz)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, nopCloser{}, nil
+}
+
+// tarToMapFS decompresses r in full into an in-memory fstest.MapFS. This
+// costs memory proportional to the archive, but archive/tar only exposes a
+// forward-only reader and the listing/Range-serving code needs random
+// access, so there's no cheaper option without a custom fs.FS.
+func tarToMapFS(r io.Reader) (fs.FS, error) {
+	tr := tar.NewReader(r)
+	m := fstest.MapFS{}
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if name == "" || name == "." {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			m[name] = &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: hdr.ModTime}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > maxDecompressedBytes {
+				return nil, fmt.Errorf("archivefs: archive exceeds %d byte decompressed size limit", maxDecompressedBytes)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = &fstest.MapFile{Data: data, Mode: 0644, ModTime: hdr.ModTime}
+		}
+	}
+	return m, nil
+}
+
+func openISO(p string) (fs.FS, io.Closer, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	img, err := iso9660.OpenImage(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	root, err := img.RootDir()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	m := fstest.MapFS{}
+	var total int64
+	if err := walkISO(root, "", m, &total); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return m, f, nil
+}
+
+func walkISO(dir *iso9660.File, prefix string, m fstest.MapFS, total *int64) error {
+	children, err := dir.GetChildren()
+	if err != nil {
+		return err
+	}
+	for _, c := range children {
+		name := path.Join(prefix, c.Name())
+		if c.IsDir() {
+			m[name] = &fstest.MapFile{Mode: fs.ModeDir | 0755}
+			if err := walkISO(c, name, m, total); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := io.ReadAll(c.Reader())
+		if err != nil {
+			return err
+		}
+		*total += int64(len(data))
+		if *total > maxDecompressedBytes {
+			return fmt.Errorf("archivefs: archive exceeds %d byte decompressed size limit", maxDecompressedBytes)
+		}
+		m[name] = &fstest.MapFile{Data: data, Mode: 0644}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Package blobcache is a tiny size-bounded, least-recently-used cache of
+// byte blobs, used to avoid re-decompressing the same archive entry on
+// every Range request.
+package blobcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type entry struct {
+	key  string
+	data []byte
+}
+
+// Cache is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// New returns a Cache that evicts least-recently-used entries once the
+// total size of its contents would exceed maxBytes. A maxBytes of 0 makes
+// the cache never retain anything.
+func New(maxBytes int64) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// MaxBytes returns the cache's configured size bound, so callers can decide
+// whether a blob is even worth attempting to buffer before it's built.
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*entry).data, true
+}
+
+// Put stores data under key, evicting older entries as needed to stay
+// within maxBytes. It's a no-op if data alone is larger than maxBytes.
+func (c *Cache) Put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxBytes <= 0 || int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	if el, ok := c.items[key]; ok {
+		c.curBytes -= int64(len(el.Value.(*entry).data))
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+
+	el := c.ll.PushFront(&entry{key: key, data: data})
+	c.items[key] = el
+	c.curBytes += int64(len(data))
+
+	for c.curBytes > c.maxBytes {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		ev := back.Value.(*entry)
+		c.ll.Remove(back)
+		delete(c.items, ev.key)
+		c.curBytes -= int64(len(ev.data))
+	}
+}
@@ -0,0 +1,117 @@
+// Package thumbnail decodes and downscales images for srv's grid directory
+// listing.
+//
+// Video thumbnailing (mp4/webm) isn't implemented here: none of the stdlib
+// or x/image decoders can pull a frame out of a video container, and doing
+// that properly means shelling out to something like ffmpeg. Callers should
+// still offer the grid layout for directories containing video, just
+// without a generated preview image.
+package thumbnail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageExts are the source image formats Generate can decode.
+var ImageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+}
+
+// Dir returns (and creates, if needed) the directory thumbnails are cached
+// under, rooted at the OS's per-user cache directory.
+func Dir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "srv", "thumbnails")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// cacheKey derives a stable, filesystem-safe cache filename from the
+// attributes that should invalidate a cached thumbnail if they change:
+// the source's identifying path, size, and mtime, plus the requested edge.
+func cacheKey(path string, size, modTime int64, maxEdge int) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d", path, size, modTime, maxEdge)))
+	return hex.EncodeToString(h[:]) + ".jpg"
+}
+
+// Generate decodes src, scales it down so its longest edge is maxEdge
+// pixels (images already smaller than that are left at their original
+// size), and returns the result encoded as JPEG.
+func Generate(src io.Reader, maxEdge int) ([]byte, error) {
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("thumbnail: source image has zero dimension")
+	}
+
+	scale := float64(maxEdge) / float64(w)
+	if s := float64(maxEdge) / float64(h); s < scale {
+		scale = s
+	}
+	if scale > 1 {
+		scale = 1
+	}
+	dw, dh := int(float64(w)*scale), int(float64(h)*scale)
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Cached returns path's thumbnail at maxEdge, reading it from the on-disk
+// cache when (path, size, modTime, maxEdge) match a prior run, and
+// generating + storing it from src otherwise. path only needs to be a
+// stable identifier for src (e.g. its served URL path); it's never opened
+// directly.
+func Cached(path string, size, modTime int64, maxEdge int, src io.Reader) ([]byte, error) {
+	dir, err := Dir()
+	if err != nil {
+		return Generate(src, maxEdge)
+	}
+
+	fp := filepath.Join(dir, cacheKey(path, size, modTime, maxEdge))
+	if data, err := os.ReadFile(fp); err == nil {
+		return data, nil
+	}
+
+	data, err := Generate(src, maxEdge)
+	if err != nil {
+		return nil, err
+	}
+	_ = os.WriteFile(fp, data, 0644) // best-effort; a cache write failure shouldn't fail the request
+	return data, nil
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
-	"mime"
 	"net"
 	"net/http"
 	"net/url"
@@ -19,107 +21,476 @@ import (
 	"strings"
 	"time"
 
+	"github.com/joshuarli/srv/internal/archivefs"
+	"github.com/joshuarli/srv/internal/blobcache"
 	"github.com/joshuarli/srv/internal/humanize"
+	"github.com/joshuarli/srv/internal/thumbnail"
 )
 
+// videoExts are offered the grid layout alongside thumbnail.ImageExts, even
+// though we can't generate a preview image for them yet (see the thumbnail
+// package doc comment).
+var videoExts = map[string]bool{".mp4": true, ".webm": true}
+
+func isThumbnailable(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return thumbnail.ImageExts[ext] || videoExts[ext]
+}
+
+// defaultZipCacheBytes bounds archiveEntryCache, the decompressed-entry
+// cache used to make in-archive files seekable for http.ServeContent.
+const defaultZipCacheBytes = 64 << 20
+
+// defaultThumbMaxEdge is the default longest edge, in pixels, of a
+// generated thumbnail.
+const defaultThumbMaxEdge = 200
+
+// archiveEntryCache holds fully-decompressed archive entries, keyed by
+// archive path + entry path, so repeated and Range requests against the
+// same in-archive file don't redo the decompression. Sized by main() from
+// -zip-cache-bytes.
+var archiveEntryCache = blobcache.New(defaultZipCacheBytes)
+
+// errEntryTooLargeToBuffer is returned by archiveEntryReadSeeker when an
+// entry is larger than archiveEntryCache's size bound: buffering it in
+// memory to satisfy http.ServeContent's Range support isn't worth it (it'd
+// never be cached anyway, so every request, and every Range sub-request a
+// video player issues while scrubbing, would re-decompress the whole thing).
+// Callers should fall back to a forward-only copy instead.
+var errEntryTooLargeToBuffer = errors.New("archive entry too large to buffer for Range support")
+
+// archiveEntryReadSeeker returns a seekable view of innerPath inside the
+// archive fsys, mounted at archivePath, whose stat size is size. Entries up
+// to archiveEntryCache's bound are decompressed in full and cached,
+// trading memory for Range/If-Modified-Since support that a forward-only
+// decompressing reader can't offer; larger entries return
+// errEntryTooLargeToBuffer instead of buffering.
+func archiveEntryReadSeeker(fsys fs.FS, archivePath, innerPath string, size int64) (io.ReadSeeker, error) {
+	if size > archiveEntryCache.MaxBytes() {
+		return nil, errEntryTooLargeToBuffer
+	}
+
+	key := archivePath + "\x00" + innerPath
+	if data, ok := archiveEntryCache.Get(key); ok {
+		return bytes.NewReader(data), nil
+	}
+
+	f, err := fsys.Open(innerPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveEntryCache.Put(key, data)
+	return bytes.NewReader(data), nil
+}
+
 type context struct {
-	srvDir string
+	fsys fs.FS
+
+	// diskRoot is the real filesystem path fsys was mounted from, when it's
+	// a plain directory ("" when fsys is backed by something else, e.g. a
+	// zip). It's only used by code that still has to shell out to a real
+	// path (bulk zip download, browsing an archive nested inside the served
+	// tree, the isSymlink check) until that code grows an fs.FS-native
+	// equivalent.
+	diskRoot string
+
+	// rootID identifies this root (its absolute path, whether a directory
+	// or a zip file) and is folded into thumbnail cache keys so entries
+	// from two different served trees never collide in the shared,
+	// cross-invocation on-disk thumbnail cache.
+	rootID string
+
+	// noShortcutFollow disables resolving .url/.desktop/.webloc shortcut
+	// files into redirects, serving their raw contents instead.
+	noShortcutFollow bool
+
+	// thumbnails enables the ?thumb= grid directory listing.
+	thumbnails   bool
+	thumbMaxEdge int
+}
+
+// shortcutExts are the shortcut file extensions the handler resolves into
+// redirects unless noShortcutFollow is set.
+var shortcutExts = map[string]bool{".url": true, ".desktop": true, ".webloc": true}
+
+// shortcutURL extracts the target URL from a Windows .url, freedesktop
+// .desktop, or Apple .webloc shortcut file.
+func shortcutURL(ext string, data []byte) (string, error) {
+	switch ext {
+	case ".url":
+		return parseINIShortcut(data, "InternetShortcut", "URL")
+	case ".desktop":
+		return parseINIShortcut(data, "Desktop Entry", "URL")
+	case ".webloc":
+		return parseWeblocURL(data)
+	default:
+		return "", fmt.Errorf("%q is not a recognized shortcut extension", ext)
+	}
+}
+
+// parseINIShortcut finds key= within [section] of an INI-style shortcut
+// file (.url and .desktop both use this format).
+func parseINIShortcut(data []byte, section, key string) (string, error) {
+	var current string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok && strings.TrimSpace(k) == key {
+			if v = strings.TrimSpace(v); v != "" {
+				return v, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no %s= in [%s] section", key, section)
+}
+
+// parseWeblocURL pulls the <string> value paired with a <key>URL</key> out
+// of a .webloc file's plist <dict>. Struct-tag-based xml.Unmarshal can't
+// express that pairing (key and string are just sibling elements, matched
+// by position, not nesting), so this walks the token stream instead,
+// remembering the most recently seen <key> and matching it against the
+// <string> that follows it.
+func parseWeblocURL(data []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var lastKey string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "key":
+			if err := dec.DecodeElement(&lastKey, &start); err != nil {
+				return "", err
+			}
+		case "string":
+			var value string
+			if err := dec.DecodeElement(&value, &start); err != nil {
+				return "", err
+			}
+			if lastKey == "URL" {
+				return value, nil
+			}
+			lastKey = ""
+		}
+	}
+	return "", fmt.Errorf("no URL string found in webloc plist")
+}
+
+// relFSPath turns a URL path (which starts with "/") into a path valid for
+// fs.FS, which must be unrooted and use "." to mean the root itself.
+func relFSPath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// isSymlink reports whether relPath, or any directory on the way to it, is
+// a symlink on disk, given diskRoot, the real directory c.fsys was mounted
+// from ("" if it wasn't mounted from a plain directory, e.g. a zip root, in
+// which case there's nothing to check and this always returns false).
+// fs.FS has no Lstat equivalent and always follows symlinks, so this goes
+// around it straight to the real path instead.
+func isSymlink(diskRoot, relPath string) bool {
+	if diskRoot == "" {
+		return false
+	}
+	for p := relPath; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		fi, err := os.Lstat(filepath.Join(diskRoot, filepath.FromSlash(p)))
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // We write the shortest browser-valid base64 data string,
 // so that the browser does not request the favicon.
-const listingPrelude = `<head><link rel=icon href=data:,><style>* { font-family: monospace; } table { border: none; margin: 1rem; } td { padding-right: 2rem; }</style></head>
+const listingPrelude = `<head><link rel=icon href=data:,><style>* { font-family: monospace; } table { border: none; margin: 1rem; } td { padding-right: 2rem; } .thumbs { display: flex; flex-wrap: wrap; gap: 1rem; } .thumbs figure { width: 200px; margin: 0; text-align: center; } .thumbs img { max-width: 100%; max-height: 200px; display: block; }</style></head>
 <table>`
 
-func isZip(s string) bool {
-	return mime.TypeByExtension(filepath.Ext(s)) == mime.TypeByExtension(".zip")
-}
-
-func renderListing(w http.ResponseWriter, r *http.Request, f *os.File) error {
-	files, err := f.Readdir(-1)
+func renderListing(w http.ResponseWriter, r *http.Request, fsys fs.FS, relPath string, thumbnails bool) error {
+	entries, err := fs.ReadDir(fsys, relPath)
 	if err != nil {
 		return err
 	}
 
-	io.WriteString(w, listingPrelude)
-
-	sort.Slice(files, func(i, j int) bool {
+	sort.Slice(entries, func(i, j int) bool {
 		// TODO: add switch to make case sensitive
 		// TODO: add switch to disable natural sort
 		return humanize.NaturalLess(
-			strings.ToLower(files[i].Name()),
-			strings.ToLower(files[j].Name()),
+			strings.ToLower(entries[i].Name()),
+			strings.ToLower(entries[j].Name()),
 		)
 	})
 
+	var mediaEntries, otherEntries []fs.DirEntry
+	for _, fi := range entries {
+		if thumbnails && !fi.IsDir() && isThumbnailable(fi.Name()) {
+			mediaEntries = append(mediaEntries, fi)
+		} else {
+			otherEntries = append(otherEntries, fi)
+		}
+	}
+
+	io.WriteString(w, listingPrelude)
+	fmt.Fprint(w, "<tr><td><a href=\"?download=zip\">download this directory as zip</a></td></tr>")
+	io.WriteString(w, "<form method=post>")
+
+	if len(mediaEntries) > 0 {
+		fmt.Fprint(w, `<tr><td colspan=3><div class=thumbs>`)
+		for _, fi := range mediaEntries {
+			fn := fi.Name()
+			fnEscaped := url.PathEscape(fn)
+			// videos don't get a generated preview yet (see the thumbnail
+			// package doc comment), just a grid slot so they stay grouped
+			// with the images instead of falling back to the plain list.
+			img := fmt.Sprintf(`<img src="?thumb=%s" loading=lazy alt="">`, fnEscaped)
+			if videoExts[strings.ToLower(filepath.Ext(fn))] {
+				img = `<p style="color: #777">(video)</p>`
+			}
+			fmt.Fprintf(w, `<figure><label><input type=checkbox name=paths value="%s"><a href="%s">%s</a></label><figcaption>%s</figcaption></figure>`, fnEscaped, fnEscaped, img, fn)
+		}
+		io.WriteString(w, "</div></td></tr>")
+	}
+
 	var fn, fnEscaped string
-	for _, fi := range files {
+	for _, fi := range otherEntries {
 		fn = fi.Name()
 		fnEscaped = url.PathEscape(fn)
-		switch m := fi.Mode(); {
-		// is a directory - render a link
-		case m&os.ModeDir != 0:
-			fmt.Fprintf(w, "<tr><td><a href=\"%s/\">%s/</a></td></tr>", fnEscaped, fn)
-		// is a regular file - render both a link and a file size
-		case m&os.ModeType == 0:
-			fs := humanize.FileSize(fi.Size())
-			fmt.Fprintf(w, "<tr><td><a href=\"%s\">%s</a></td><td>%s</td></tr>", fnEscaped, fn, fs)
+		switch {
+		// is a directory - render a link, selectable for the zip form
+		case fi.IsDir():
+			fmt.Fprintf(w, "<tr><td><input type=checkbox name=paths value=\"%s\"></td><td><a href=\"%s/\">%s/</a></td></tr>", fnEscaped, fnEscaped, fn)
+		// is a regular file - render both a link and a file size, selectable for the zip form
+		case fi.Type()&os.ModeType == 0:
+			info, err := fi.Info()
+			if err != nil {
+				return err
+			}
+			sz := humanize.FileSize(info.Size())
+			fmt.Fprintf(w, "<tr><td><input type=checkbox name=paths value=\"%s\"></td><td><a href=\"%s\">%s</a></td><td>%s</td></tr>", fnEscaped, fnEscaped, fn, sz)
 		// otherwise, don't render a clickable link
 		default:
-			fmt.Fprintf(w, "<tr><td><p style=\"color: #777\">%s</p></td></tr>", fn)
+			fmt.Fprintf(w, "<tr><td></td><td><p style=\"color: #777\">%s</p></td></tr>", fn)
 		}
 	}
 
+	fmt.Fprint(w, "<tr><td colspan=2><button type=submit>download selected as zip</button></td></tr>")
+	io.WriteString(w, "</form>")
 	io.WriteString(w, "</table>")
 	return nil
 }
 
-func renderZipFolderListing(w http.ResponseWriter, r *http.Request, f []fs.DirEntry, parentPath string) error {
-	io.WriteString(w, listingPrelude)
+// compressedExts holds file extensions that are already compressed, so
+// zipMethod can skip re-deflating them.
+var compressedExts = map[string]bool{
+	".zip": true, ".gz": true, ".bz2": true, ".xz": true, ".7z": true, ".rar": true, ".zst": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".mkv": true, ".avi": true, ".flac": true, ".ogg": true,
+}
 
-	var fnEscaped string
-	for _, fi := range f {
-		fn := fi.Name()
-		fnEscaped = path.Join(parentPath, url.PathEscape(fi.Name()))
-		switch m := fi.Type(); {
-		// is a directory - render a link
-		case m&os.ModeDir != 0:
-			fmt.Fprintf(w, "<tr><td><a href=\"/%s\">%s</a></td></tr>", fnEscaped, fn)
-		// is a regular file - render both a link and a file size
-		case m&os.ModeType == 0:
-			finfo, _ := fi.Info()
-			fs := humanize.FileSize(finfo.Size())
-			fmt.Fprintf(w, "<tr><td><a href=\"/%s\">%s</a></td><td>%s</td></tr>", fnEscaped, fn, fs)
-		// otherwise, don't render a clickable link
-		default:
-			fmt.Fprintf(w, "<tr><td><p style=\"color: #777\">%s</p></td></tr>", fn)
+// zipMethod picks STORE for file types that are already compressed (so we
+// don't waste CPU deflating incompressible bytes) and DEFLATE otherwise.
+func zipMethod(name string) uint16 {
+	if compressedExts[strings.ToLower(filepath.Ext(name))] {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// serveZipArchive streams a zip of root to w: the whole tree if names is
+// empty, or just the given root-relative entries (files or directories)
+// otherwise. Symlinks, non-regular files, and names escaping root are
+// silently skipped rather than failing the whole download.
+func serveZipArchive(w http.ResponseWriter, archiveName, root string, names []string) error {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archiveName))
+
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	addFile := func(fp, zipPath string) error {
+		fi, err := os.Lstat(fp)
+		if err != nil || fi.Mode()&os.ModeSymlink != 0 || !fi.Mode().IsRegular() {
+			return nil
+		}
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
 		}
+		hdr.Name = zipPath
+		hdr.Method = zipMethod(fp)
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(fp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err
 	}
 
-	io.WriteString(w, "</table>")
+	addTree := func(fp, prefix string) error {
+		return filepath.WalkDir(fp, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(fp, p)
+			if err != nil {
+				return err
+			}
+			return addFile(p, path.Join(prefix, filepath.ToSlash(rel)))
+		})
+	}
+
+	if len(names) == 0 {
+		return addTree(root, "")
+	}
+
+	for _, name := range names {
+		fp := filepath.Join(root, name)
+		if rel, err := filepath.Rel(root, fp); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue // selection escapes root
+		}
+		fi, err := os.Lstat(fp)
+		if err != nil || fi.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if fi.IsDir() {
+			if err := addTree(fp, filepath.ToSlash(name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := addFile(fp, filepath.ToSlash(name)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func renderZipListing(w http.ResponseWriter, r *http.Request, f zip.Reader, parentPath string) error {
+// serveThumbnail writes a JPEG thumbnail of the image at name (a plain file
+// name, not a path) inside dirRelPath to w, using fsys to read the source.
+// rootID identifies the tree fsys was opened from (c.rootID, or an
+// archivePath for an in-tree archive) and is folded into the cache key
+// alongside dirRelPath+name, since the on-disk thumbnail cache is shared
+// across every root srv has ever served and two different trees can easily
+// have same-named, same-sized entries (most commonly zip entries, which
+// often share a fixed default mtime).
+func serveThumbnail(w http.ResponseWriter, fsys fs.FS, rootID, dirRelPath, name string, maxEdge int) error {
+	if name == "" || strings.ContainsRune(name, '/') {
+		return fmt.Errorf("invalid thumbnail name %q", name)
+	}
+	if !thumbnail.ImageExts[strings.ToLower(filepath.Ext(name))] {
+		return fmt.Errorf("unsupported thumbnail source %q", name)
+	}
+
+	entryPath := path.Join(dirRelPath, name)
+	fi, err := fs.Stat(fsys, entryPath)
+	if err != nil {
+		return err
+	}
+	f, err := fsys.Open(entryPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cacheKey := rootID + "\x00" + entryPath
+	data, err := thumbnail.Cached(cacheKey, fi.Size(), fi.ModTime().Unix(), maxEdge, f)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	_, err = w.Write(data)
+	return err
+}
+
+// renderArchiveListing renders the contents of innerPath (a directory) inside
+// the archive fsys, mounted at archivePath. An innerPath of "" is the
+// archive root, which additionally gets a link to download the archive
+// itself.
+func renderArchiveListing(w http.ResponseWriter, r *http.Request, fsys fs.FS, archivePath, innerPath string, thumbnails bool) error {
+	dir := innerPath
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
 
 	io.WriteString(w, listingPrelude)
-	fmt.Fprint(w, "<tr><td><a href=?download>download zip</a></td></tr>")
+	if innerPath == "" {
+		fmt.Fprint(w, "<tr><td><a href=?download>download archive</a></td></tr>")
+	}
+
+	var mediaEntries, otherEntries []fs.DirEntry
+	for _, fi := range entries {
+		if thumbnails && !fi.IsDir() && isThumbnailable(fi.Name()) {
+			mediaEntries = append(mediaEntries, fi)
+		} else {
+			otherEntries = append(otherEntries, fi)
+		}
+	}
 
-	var fnEscaped string
-	for _, fi := range f.File {
-		fn := fi.Name
-		fnEscaped = path.Join(parentPath, url.PathEscape(fi.Name))
-		switch m := fi.Mode(); {
+	if len(mediaEntries) > 0 {
+		fmt.Fprint(w, `<tr><td colspan=2><div class=thumbs>`)
+		for _, fi := range mediaEntries {
+			fn := fi.Name()
+			fnEscaped := path.Join(archivePath, innerPath, url.PathEscape(fn))
+			img := fmt.Sprintf(`<img src="?thumb=%s" loading=lazy alt="">`, url.PathEscape(fn))
+			if videoExts[strings.ToLower(filepath.Ext(fn))] {
+				img = `<p style="color: #777">(video)</p>`
+			}
+			fmt.Fprintf(w, `<figure><a href="/%s">%s</a><figcaption>%s</figcaption></figure>`, fnEscaped, img, fn)
+		}
+		io.WriteString(w, "</div></td></tr>")
+	}
+
+	for _, fi := range otherEntries {
+		fn := fi.Name()
+		fnEscaped := path.Join(archivePath, innerPath, url.PathEscape(fn))
+		switch {
 		// is a directory - render a link
-		case m&os.ModeDir != 0 && len(strings.Split(strings.TrimSuffix(fn, "/"), "/")) == 1:
-			fmt.Fprintf(w, "<tr><td><a href=\"/%s\">%s</a></td></tr>", fnEscaped, fn)
+		case fi.IsDir():
+			fmt.Fprintf(w, "<tr><td><a href=\"/%s/\">%s/</a></td></tr>", fnEscaped, fn)
 		// is a regular file - render both a link and a file size
-		case m&os.ModeType == 0 && len(strings.Split(fn, "/")) == 1:
-			fs := humanize.FileSize(int64(fi.UncompressedSize64))
-			fmt.Fprintf(w, "<tr><td><a href=\"/%s\">%s</a></td><td>%s</td></tr>", fnEscaped, fn, fs)
-			// otherwise, don't render a clickable link
-			//default:
-			//	fmt.Fprintf(w, "<tr><td><p style=\"color: #777\">%s</p></td></tr>", fn)
+		default:
+			info, err := fi.Info()
+			if err != nil {
+				return err
+			}
+			sz := humanize.FileSize(info.Size())
+			fmt.Fprintf(w, "<tr><td><a href=\"/%s\">%s</a></td><td>%s</td></tr>", fnEscaped, fn, sz)
 		}
 	}
 
@@ -148,58 +519,100 @@ func (c *context) handler(w http.ResponseWriter, r *http.Request) {
 
 		dirs := strings.Split(fp, "/")
 		var fsPath []string
-		var zipFile string
-		var zipPath []string
+		var archiveFile string
+		var archiveInner []string
 		if len(dirs) > 0 {
 			for _, fpath := range dirs {
-				if len(zipFile) == 0 {
-					if isZip(fpath) {
-						zipFile = fpath
+				if len(archiveFile) == 0 {
+					if archivefs.Ext(fpath) != "" {
+						archiveFile = fpath
 					} else {
 						fsPath = append(fsPath, fpath)
 					}
 				} else {
-					zipPath = append(zipPath, fpath)
+					archiveInner = append(archiveInner, fpath)
 				}
 			}
 		}
 
-		if len(zipFile) > 0 {
-			zipFilePath := path.Join(c.srvDir, path.Join(append(fsPath, zipFile)...))
-			z, err := zip.OpenReader(zipFilePath)
-			if err != nil {
-				log.Fatal(err)
+		if len(archiveFile) > 0 {
+			// archivefs.Open still wants a real path on disk; this only
+			// works when fsys is mounted from a plain directory.
+			if c.diskRoot == "" {
+				http.Error(w, "browsing an archive nested inside this root isn't supported yet", http.StatusNotImplemented)
+				return
 			}
-			defer z.Close()
+			archivePath := path.Join(c.diskRoot, path.Join(append(fsPath, archiveFile)...))
 
 			_, isDownload := r.URL.Query()["download"]
-
 			if isDownload {
-				fp, _ := filepath.Abs(fp)
-				f, _ := os.Open(fp)
-				defer f.Close()
-				http.ServeContent(w, r, fp, time.Time{}, f)
-			} else if len(zipPath) > 0 {
-				zipInternalPath := path.Join(zipPath...)
-				f, _ := z.Open(zipInternalPath)
-				defer f.Close()
-				fi, _ := fs.Stat(z, zipInternalPath)
-				if fi.IsDir() {
-					fdir, _ := fs.ReadDir(z, zipInternalPath)
-					err = renderZipFolderListing(w, r, fdir, path.Join(zipFilePath, zipInternalPath))
-				} else {
-					io.Copy(w, f)
+				af, err := os.Open(archivePath)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("failed to open archive: %s", err), http.StatusInternalServerError)
+					return
 				}
-			} else {
-				err = renderZipListing(w, r, z.Reader, zipFilePath)
+				defer af.Close()
+				http.ServeContent(w, r, archivePath, time.Time{}, af)
+				return
 			}
 
+			fsys, closer, err := archivefs.Open(archivePath)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to open archive: %s", err), http.StatusInternalServerError)
+				return
+			}
+			defer closer.Close()
+
+			innerPath := path.Join(archiveInner...)
+
+			if thumbName := r.URL.Query().Get("thumb"); c.thumbnails && thumbName != "" {
+				if err := serveThumbnail(w, fsys, archivePath, innerPath, thumbName, c.thumbMaxEdge); err != nil {
+					http.Error(w, "failed to generate thumbnail: "+err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+
+			if innerPath == "" {
+				if err := renderArchiveListing(w, r, fsys, archivePath, "", c.thumbnails); err != nil {
+					http.Error(w, "failed to render archive listing: "+err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+
+			ffi, err := fs.Stat(fsys, innerPath)
+			if err != nil {
+				http.Error(w, "file not found in archive", http.StatusNotFound)
+				return
+			}
+			if ffi.IsDir() {
+				if err := renderArchiveListing(w, r, fsys, archivePath, innerPath, c.thumbnails); err != nil {
+					http.Error(w, "failed to render archive listing: "+err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+
+			rs, err := archiveEntryReadSeeker(fsys, archivePath, innerPath, ffi.Size())
+			if errors.Is(err, errEntryTooLargeToBuffer) {
+				af, err := fsys.Open(innerPath)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("failed to open archive entry: %s", err), http.StatusInternalServerError)
+					return
+				}
+				defer af.Close()
+				io.Copy(w, af)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to open archive entry: %s", err), http.StatusInternalServerError)
+				return
+			}
+			http.ServeContent(w, r, innerPath, ffi.ModTime(), rs)
 			return
 		}
 
-		fp = path.Join(c.srvDir, fp)
+		relPath := relFSPath(fp)
 
-		fi, err := os.Lstat(fp)
+		fi, err := fs.Stat(c.fsys, relPath)
 		if err != nil {
 			// NOTE: errors.Is is generally preferred, since it can unwrap errors created like so:
 			//     fmt.Errorf("can't read file: %w", err)
@@ -212,42 +625,133 @@ func (c *context) handler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		f, err := os.Open(fp)
+		// fs.Stat (and os.DirFS.Open) follow symlinks, unlike the os.Lstat
+		// the pre-fs.FS version of this handler used; reject them explicitly
+		// so a symlink under the root can't be used to read or list
+		// anything outside it.
+		if isSymlink(c.diskRoot, relPath) {
+			http.Error(w, "file is a symlink", http.StatusForbidden)
+			return
+		}
+
+		if fi.IsDir() {
+			if thumbName := r.URL.Query().Get("thumb"); c.thumbnails && thumbName != "" {
+				if err := serveThumbnail(w, c.fsys, c.rootID, relPath, thumbName, c.thumbMaxEdge); err != nil {
+					http.Error(w, "failed to generate thumbnail: "+err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+
+			if r.URL.Query().Get("download") == "zip" {
+				if c.diskRoot == "" {
+					http.Error(w, "bulk zip download isn't supported for this root yet", http.StatusNotImplemented)
+					return
+				}
+				dp := path.Join(c.diskRoot, relPath)
+				archiveName := filepath.Base(dp) + ".zip"
+				if err := serveZipArchive(w, archiveName, dp, nil); err != nil {
+					http.Error(w, "failed to build zip: "+err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+		}
+
+		f, err := c.fsys.Open(relPath)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to open file: %s", err), http.StatusInternalServerError)
 			return
 		}
 		defer f.Close()
 
-		switch m := fi.Mode(); {
+		switch {
 		// is a directory - serve an index.html if it exists, otherwise generate and serve a directory listing
-		case m&os.ModeDir != 0:
-			// XXX: if a symlink has name "index.html", it will be served here.
-			// i could add an extra lstat here, but the scenario is just too rare
-			// to justify the additional file operation.
-			html, err := os.Open(path.Join(fp, "index.html"))
-			if err == nil {
-				io.Copy(w, html)
-				html.Close()
-				return
+		case fi.IsDir():
+			indexRel := path.Join(relPath, "index.html")
+			if !isSymlink(c.diskRoot, indexRel) {
+				if html, err := c.fsys.Open(indexRel); err == nil {
+					io.Copy(w, html)
+					html.Close()
+					return
+				}
 			}
-			html.Close()
-			err = renderListing(w, r, f)
+			err = renderListing(w, r, c.fsys, relPath, c.thumbnails)
 			if err != nil {
 				http.Error(w, "failed to render directory listing: "+err.Error(), http.StatusInternalServerError)
 			}
 		// is a regular file - serve its contents
-		case m&os.ModeType == 0:
+		case fi.Mode()&os.ModeType == 0:
+			if ext := strings.ToLower(filepath.Ext(relPath)); !c.noShortcutFollow && shortcutExts[ext] {
+				data, err := io.ReadAll(f)
+				if err != nil {
+					http.Error(w, "failed to read shortcut file: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				target, err := shortcutURL(ext, data)
+				if err != nil {
+					http.Error(w, "malformed shortcut file: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+
 			// This deduces a mimetype from the file extension first, then falls back to DetectContentType.
 			// io.Copy'ing would only DetectContentType, which is insufficient for like, css files.
-			http.ServeContent(w, r, fp, time.Time{}, f)
-		// is a symlink - refuse to serve
-		case m&os.ModeSymlink != 0:
-			// TODO: add a flag to allow serving symlinks
-			http.Error(w, "file is a symlink", http.StatusForbidden)
+			//
+			// http.ServeContent needs an io.ReadSeeker; fs.File doesn't guarantee
+			// one. os.DirFS files are seekable, but zip.Reader files aren't, so
+			// those are buffered through archiveEntryReadSeeker, with a plain
+			// copy for entries too large to buffer.
+			if rs, ok := f.(io.ReadSeeker); ok {
+				http.ServeContent(w, r, relPath, fi.ModTime(), rs)
+			} else if rs, err := archiveEntryReadSeeker(c.fsys, c.rootID, relPath, fi.Size()); err == nil {
+				http.ServeContent(w, r, relPath, fi.ModTime(), rs)
+			} else {
+				io.Copy(w, f)
+			}
 		default:
 			http.Error(w, "file isn't a regular file or directory", http.StatusForbidden)
 		}
+	// a multi-file selection, posted by the checkbox form renderListing emits
+	case http.MethodPost:
+		fp, err := url.PathUnescape(r.URL.Path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to path unescape: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if c.diskRoot == "" {
+			http.Error(w, "bulk zip download isn't supported for this root yet", http.StatusNotImplemented)
+			return
+		}
+		relPath := relFSPath(fp)
+
+		fi, err := fs.Stat(c.fsys, relPath)
+		if err != nil || !fi.IsDir() {
+			http.Error(w, "can only post a selection to a directory", http.StatusBadRequest)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "failed to parse form: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		names := r.Form["paths"]
+		if len(names) == 0 {
+			http.Error(w, "no paths selected", http.StatusBadRequest)
+			return
+		}
+		// renderListing sends paths back URL-escaped, since that's also how
+		// they end up in the checkbox's value= attribute; undo that here.
+		for i, n := range names {
+			if un, err := url.PathUnescape(n); err == nil {
+				names[i] = un
+			}
+		}
+
+		dp := path.Join(c.diskRoot, relPath)
+		if err := serveZipArchive(w, "selection.zip", dp, names); err != nil {
+			http.Error(w, "failed to build zip: "+err.Error(), http.StatusInternalServerError)
+		}
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -266,27 +770,45 @@ func main() {
 	flag.Usage = func() {
 		die(`srv %s (go version %s)
 
-usage: %s [-q] [-p port] [-c certfile -k keyfile] directory
+usage: %s [-q] [-p port] [-c certfile -k keyfile] [-root root] [directory]
 
-directory       path to directory to serve (default: .)
+directory       path to directory to serve (default: .); shorthand for -root
 
 -q              quiet; disable all logging
 -p port         port to listen on (default: 8000)
 -b address      listener socket's bind address (default: 127.0.0.1)
 -c certfile     optional path to a PEM-format X.509 certificate
 -k keyfile      optional path to a PEM-format X.509 key
+-root root      path to a directory or a .zip file to serve (default: directory, or .)
+-no-shortcut-follow
+                serve .url/.desktop/.webloc shortcut files raw instead of redirecting to their target
+-zip-cache-bytes bytes
+                max bytes of decompressed in-archive file content to cache (default: 67108864)
+-thumbnails     generate image thumbnails and switch to a grid directory listing
+                (videos are placed in the grid without a preview image)
+-thumb-max-edge pixels
+                longest edge of a generated thumbnail, when -thumbnails is set (default: 200)
 `, VERSION, runtime.Version(), os.Args[0])
 	}
 
-	var quiet bool
-	var port, bindAddr, certFile, keyFile string
+	var quiet, noShortcutFollow, thumbnails bool
+	var port, bindAddr, certFile, keyFile, root string
+	var zipCacheBytes int64
+	var thumbMaxEdge int
 	flag.BoolVar(&quiet, "q", false, "")
 	flag.StringVar(&port, "p", "8000", "")
 	flag.StringVar(&bindAddr, "b", "127.0.0.1", "")
 	flag.StringVar(&certFile, "c", "", "")
 	flag.StringVar(&keyFile, "k", "", "")
+	flag.StringVar(&root, "root", "", "")
+	flag.BoolVar(&noShortcutFollow, "no-shortcut-follow", false, "")
+	flag.Int64Var(&zipCacheBytes, "zip-cache-bytes", defaultZipCacheBytes, "")
+	flag.BoolVar(&thumbnails, "thumbnails", false, "")
+	flag.IntVar(&thumbMaxEdge, "thumb-max-edge", defaultThumbMaxEdge, "")
 	flag.Parse()
 
+	archiveEntryCache = blobcache.New(zipCacheBytes)
+
 	certFileSpecified := certFile != ""
 	keyFileSpecified := keyFile != ""
 	if certFileSpecified != keyFileSpecified {
@@ -299,22 +821,41 @@ directory       path to directory to serve (default: .)
 		die("Could not resolve the address to listen to: %s", listenAddr)
 	}
 
-	srvDir := "."
-	posArgs := flag.Args()
-	if len(posArgs) > 0 {
-		srvDir = posArgs[0]
+	if root == "" {
+		root = "."
+		if posArgs := flag.Args(); len(posArgs) > 0 {
+			root = posArgs[0]
+		}
 	}
-	f, err := os.Open(srvDir)
+
+	rfi, err := os.Stat(root)
 	if err != nil {
 		die(err.Error())
 	}
-	defer f.Close()
-	if fi, err := f.Stat(); err != nil || !fi.IsDir() {
-		die("%s isn't a directory.", srvDir)
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		die(err.Error())
 	}
 
-	c := &context{
-		srvDir: srvDir,
+	var c context
+	c.noShortcutFollow = noShortcutFollow
+	c.thumbnails = thumbnails
+	c.thumbMaxEdge = thumbMaxEdge
+	c.rootID = absRoot
+	switch {
+	case rfi.IsDir():
+		c.fsys = os.DirFS(root)
+		c.diskRoot = root
+	case archivefs.Ext(root) == ".zip":
+		fsys, closer, err := archivefs.Open(root)
+		if err != nil {
+			die(err.Error())
+		}
+		defer closer.Close()
+		c.fsys = fsys
+	default:
+		die("%s isn't a directory or a supported archive.", root)
 	}
 
 	if quiet {
@@ -325,10 +866,10 @@ directory       path to directory to serve (default: .)
 	http.HandleFunc("/", c.handler)
 
 	if certFileSpecified && keyFileSpecified {
-		log.Printf("\tServing %s over HTTPS on %s", srvDir, listenAddr)
+		log.Printf("\tServing %s over HTTPS on %s", root, listenAddr)
 		err = http.ListenAndServeTLS(listenAddr, certFile, keyFile, nil)
 	} else {
-		log.Printf("\tServing %s over HTTP on %s", srvDir, listenAddr)
+		log.Printf("\tServing %s over HTTP on %s", root, listenAddr)
 		err = http.ListenAndServe(listenAddr, nil)
 	}
 